@@ -0,0 +1,151 @@
+// Package common holds the worker's on-disk configuration (config.json) and
+// the handful of path-resolution helpers every admin subcommand needs
+// before it can do anything else.
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/urfave/cli"
+)
+
+// Conf is the current process's live configuration.  It's nil until
+// LoadDefaults or LoadConf is called (every admin subcommand that touches
+// it does so first).
+var Conf *Config
+
+// Config is the worker's config.json schema.
+type Config struct {
+	Worker_port    string `json:"worker_port"`
+	Worker_dir     string `json:"worker_dir"`
+	Registry       string `json:"registry"`
+	SOCK_base_path string `json:"sock_base_path"`
+
+	Limits  LimitsConfig  `json:"limits"`
+	Sandbox SandboxConfig `json:"sandbox"`
+}
+
+// LimitsConfig is the per-sandbox resource limits applied by whichever
+// backend is in use (cgroups for SOCK, the OCI resources block for
+// gvsandbox).
+type LimitsConfig struct {
+	Mem_mb      int `json:"mem_mb"`
+	Cpu_percent int `json:"cpu_percent"`
+	Procs       int `json:"procs"`
+}
+
+// SandboxConfig selects and configures the worker's SandboxPool backend.
+// Kind chooses the backend ("sock", "docker", or "gvisor" -- only "gvisor"
+// is implemented in this part of the repo; see server.NewSandboxPool), e.g.
+// `-o sandbox.kind=gvisor`.
+type SandboxConfig struct {
+	Kind string `json:"kind"`
+
+	Gvisor GvisorConfig `json:"gvisor"`
+
+	// Restore_from, if set, pre-populates the pool at worker startup by
+	// restoring Restore_count copies from the CRIU images at this
+	// directory (written by a prior `ol checkpoint`) instead of forking
+	// them, e.g. `-o sandbox.restore_from=/snapshots/warm-py`.
+	Restore_from  string `json:"restore_from"`
+	Restore_count int    `json:"restore_count"`
+}
+
+// GvisorConfig configures the gvsandbox backend's `runsc` invocations.
+type GvisorConfig struct {
+	Runtime_path string `json:"runtime_path"` // path to the runsc binary; "" resolves via $PATH
+	Platform     string `json:"platform"`     // runsc --platform: "ptrace" or "kvm"; "" uses runsc's default
+	Network      string `json:"network"`      // runsc --network: "sandbox", "host", or "none"; "" uses runsc's default
+}
+
+// LoadDefaults seeds Conf with this worker's defaults, all rooted at olPath
+// (the directory GetOlPath resolved for this invocation).
+func LoadDefaults(olPath string) error {
+	Conf = &Config{
+		Worker_port:    "5000",
+		Worker_dir:     filepath.Join(olPath, "worker"),
+		Registry:       filepath.Join(olPath, "registry"),
+		SOCK_base_path: filepath.Join(olPath, "lambda"),
+		Limits: LimitsConfig{
+			Mem_mb:      512,
+			Cpu_percent: 100,
+			Procs:       64,
+		},
+		Sandbox: SandboxConfig{
+			Kind: "sock",
+		},
+	}
+	return nil
+}
+
+// SaveConf writes Conf to path as indented JSON.
+func SaveConf(path string) error {
+	b, err := json.MarshalIndent(Conf, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+// LoadConf reads Conf from a config.json previously written by SaveConf (or
+// by overrideOpts, which starts from one and applies -o/--patch-file on
+// top).
+func LoadConf(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	conf := &Config{}
+	if err := json.Unmarshal(b, conf); err != nil {
+		return err
+	}
+	Conf = conf
+	return nil
+}
+
+// DumpConfStr renders Conf as indented JSON, e.g. to show a new worker's
+// defaults right after `ol new` writes them.
+func DumpConfStr() string {
+	b, err := json.MarshalIndent(Conf, "", "\t")
+	if err != nil {
+		return fmt.Sprintf("<could not dump config: %v>", err)
+	}
+	return string(b)
+}
+
+// ValidateConf checks that conf (typically produced by applying -o/
+// --patch-file overrides to a map[string]any parsed from config.json)
+// round-trips cleanly into a Config, so a typo'd or type-mismatched
+// override (e.g. limits.procs set to a string) is caught before it's
+// written to disk rather than surfacing later as a confusing failure deep
+// inside whatever reads the saved override.
+func ValidateConf(conf map[string]any) error {
+	b, err := json.Marshal(conf)
+	if err != nil {
+		return fmt.Errorf("could not marshal config for validation: %v", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+	var parsed Config
+	if err := decoder.Decode(&parsed); err != nil {
+		return fmt.Errorf("invalid config: %v", err)
+	}
+
+	return nil
+}
+
+// GetOlPath resolves the OL worker directory a command should operate
+// against: the --path/-p flag if given, else "default-ol" in the current
+// directory.
+func GetOlPath(ctx *cli.Context) (string, error) {
+	olPath := ctx.String("path")
+	if olPath == "" {
+		olPath = "default-ol"
+	}
+	return filepath.Abs(olPath)
+}
@@ -0,0 +1,233 @@
+// Package configpatch lets the "-o" flag (and "--patch-file") describe
+// edits to config.json as RFC 6902 JSON Patch operations addressed by RFC
+// 6901 JSON Pointers, instead of the old dotted-key scheme that could only
+// overwrite existing scalar leaves.  That scheme silently rejected array
+// edits and couldn't add a new key, which matters more every time
+// common.Conf grows a new list (registries, plugins, per-lambda overrides).
+package configpatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Op is one RFC 6902 operation: {"op": "...", "path": "/a/b", "value": ...}.
+// Remove/copy/move/test never set Value.
+type Op struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	From  string `json:"from,omitempty"`
+	Value any    `json:"value,omitempty"`
+}
+
+// ParseOptsString turns a "-o" argument into a list of patch operations.
+// Three forms are accepted, and may be mixed by separating them with
+// commas:
+//
+//	opt1=val1,opt2=val2     legacy dotted-key shorthand; converted to a
+//	                        "replace" at the equivalent JSON Pointer, so
+//	                        the key must already exist (use the full op
+//	                        form with op=add to create a new one)
+//	/limits/procs=+50       a pointer path; a leading +N/-N value means
+//	                        "add N to whatever is there now" instead of a
+//	                        literal replace
+//	op=add,path=/x,value=v  one full patch operation spelled out as
+//	                        key=value fields (lets "value" itself be a
+//	                        JSON object/array containing commas)
+func ParseOptsString(optsStr string) ([]Op, error) {
+	parts := splitTopLevel(optsStr, ',')
+
+	var ops []Op
+	var pending *Op
+
+	flush := func() error {
+		if pending == nil {
+			return nil
+		}
+		if pending.Op == "" {
+			pending.Op = "replace"
+		}
+		if pending.Path == "" {
+			return fmt.Errorf("patch operation is missing a path: %+v", pending)
+		}
+		ops = append(ops, *pending)
+		pending = nil
+		return nil
+	}
+
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		key, val, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("could not parse key=val: '%s'", part)
+		}
+
+		switch key {
+		case "op":
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			pending = &Op{Op: val}
+		case "path":
+			if pending == nil {
+				pending = &Op{}
+			}
+			pending.Path = val
+		case "from":
+			if pending == nil {
+				pending = &Op{}
+			}
+			pending.From = val
+		case "value":
+			if pending == nil {
+				pending = &Op{}
+			}
+			pending.Value = parseScalarOrJSON(val)
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		default:
+			// not one of op/path/from/value: either a bare JSON Pointer
+			// assignment ("/a/b=val") or the legacy dotted-key one
+			// ("a.b=val"); either way it's a complete operation on its own
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			path := key
+			if !strings.HasPrefix(path, "/") {
+				path = "/" + strings.ReplaceAll(path, ".", "/")
+			}
+			op := "replace"
+			value := parseScalarOrJSON(val)
+			if delta, isIncr := parseIncrement(val); isIncr {
+				op = "incr"
+				value = delta
+			}
+			ops = append(ops, Op{Op: op, Path: path, Value: value})
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	return ops, nil
+}
+
+// ParsePatch decodes a standalone RFC 6902 JSON Patch document, either a
+// single operation object or an array of them, as read from --patch-file.
+func ParsePatch(b []byte) ([]Op, error) {
+	trimmed := strings.TrimSpace(string(b))
+	if strings.HasPrefix(trimmed, "[") {
+		var ops []Op
+		if err := json.Unmarshal(b, &ops); err != nil {
+			return nil, fmt.Errorf("invalid JSON Patch document: %v", err)
+		}
+		return ops, nil
+	}
+
+	var op Op
+	if err := json.Unmarshal(b, &op); err != nil {
+		return nil, fmt.Errorf("invalid JSON Patch operation: %v", err)
+	}
+	return []Op{op}, nil
+}
+
+// Apply mutates conf in place according to ops, in order.  "add" creates
+// intermediate maps as needed (the old scheme could not); "replace"
+// requires the path to already exist; "remove" deletes a key or array
+// element; "incr" (configpatch's one non-RFC-6902 extension, used for the
+// "+N"/"-N" shorthand) adds a numeric delta to whatever is already there.
+func Apply(conf map[string]any, ops []Op) error {
+	for _, op := range ops {
+		tokens, err := splitPointer(op.Path)
+		if err != nil {
+			return err
+		}
+
+		switch op.Op {
+		case "add", "replace":
+			requireExisting := op.Op == "replace"
+			if err := setAtPointer(conf, tokens, op.Value, requireExisting); err != nil {
+				return err
+			}
+		case "remove":
+			if err := removeAtPointer(conf, tokens); err != nil {
+				return err
+			}
+		case "incr":
+			cur, err := getAtPointer(conf, tokens)
+			if err != nil {
+				return err
+			}
+			n, ok := cur.(float64)
+			if !ok {
+				return fmt.Errorf("%s is a %T, not a number; can't apply +/- delta", op.Path, cur)
+			}
+			delta, _ := op.Value.(float64)
+			if err := setAtPointer(conf, tokens, n+delta, true); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported patch op: %q (supported: add, replace, remove, incr)", op.Op)
+		}
+	}
+	return nil
+}
+
+// parseScalarOrJSON lets "value" fields be either a literal scalar
+// ("50", "true", "gvisor") or a JSON object/array ({"name":"snap"}).
+// Anything that parses as JSON is used as that JSON value, so "50"
+// becomes the number 50 even when the field being set is a string (quote
+// it, "\"50\"", to keep it a string); anything else is kept as a string.
+func parseScalarOrJSON(s string) any {
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err == nil {
+		return v
+	}
+	return s
+}
+
+// parseIncrement recognizes a leading "+"/"-" integer delta, e.g. "+50".
+func parseIncrement(s string) (float64, bool) {
+	if s == "" || (s[0] != '+' && s[0] != '-') {
+		return 0, false
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, false
+	}
+	return float64(n), true
+}
+
+// splitTopLevel splits s on sep, except where sep appears nested inside
+// {...}, [...], or "...", so a -o value like {"name":"snap"} doesn't get
+// torn apart by its own commas.
+func splitTopLevel(s string, sep byte) []string {
+	var parts []string
+	depth := 0
+	inStr := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			inStr = !inStr
+		case inStr:
+			// inside a string literal, nothing else is special
+		case c == '{' || c == '[':
+			depth++
+		case c == '}' || c == ']':
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	parts = append(parts, s[start:])
+	return parts
+}
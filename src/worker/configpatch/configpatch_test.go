@@ -0,0 +1,129 @@
+package configpatch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func conf() map[string]any {
+	return map[string]any{
+		"worker_port": "5000",
+		"limits": map[string]any{
+			"procs": float64(10),
+			"mem_mb": float64(256),
+		},
+		"registries": []any{"a", "b"},
+	}
+}
+
+func TestParseOptsStringDottedKey(t *testing.T) {
+	ops, err := ParseOptsString("worker_port=5001,limits.procs=20")
+	if err != nil {
+		t.Fatalf("ParseOptsString: %v", err)
+	}
+	want := []Op{
+		{Op: "replace", Path: "/worker_port", Value: float64(5001)},
+		{Op: "replace", Path: "/limits/procs", Value: float64(20)},
+	}
+	if !reflect.DeepEqual(ops, want) {
+		t.Fatalf("got %+v, want %+v", ops, want)
+	}
+}
+
+func TestParseOptsStringIncrement(t *testing.T) {
+	ops, err := ParseOptsString("/limits/procs=+5")
+	if err != nil {
+		t.Fatalf("ParseOptsString: %v", err)
+	}
+	if len(ops) != 1 || ops[0].Op != "incr" || ops[0].Value != float64(5) {
+		t.Fatalf("unexpected ops: %+v", ops)
+	}
+}
+
+func TestParseOptsStringFullOp(t *testing.T) {
+	ops, err := ParseOptsString(`op=add,path=/registries/-,value="c"`)
+	if err != nil {
+		t.Fatalf("ParseOptsString: %v", err)
+	}
+	if len(ops) != 1 || ops[0].Op != "add" || ops[0].Path != "/registries/-" || ops[0].Value != "c" {
+		t.Fatalf("unexpected ops: %+v", ops)
+	}
+}
+
+func TestApplyReplace(t *testing.T) {
+	c := conf()
+	if err := Apply(c, []Op{{Op: "replace", Path: "/worker_port", Value: "6000"}}); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if c["worker_port"] != "6000" {
+		t.Fatalf("worker_port = %v, want 6000", c["worker_port"])
+	}
+}
+
+func TestApplyReplaceMissingKeyFails(t *testing.T) {
+	c := conf()
+	if err := Apply(c, []Op{{Op: "replace", Path: "/no_such_key", Value: "x"}}); err == nil {
+		t.Fatal("expected an error replacing a nonexistent key")
+	}
+}
+
+func TestApplyAddCreatesIntermediateMaps(t *testing.T) {
+	c := conf()
+	if err := Apply(c, []Op{{Op: "add", Path: "/new/nested/key", Value: "v"}}); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	limits := c["new"].(map[string]any)["nested"].(map[string]any)
+	if limits["key"] != "v" {
+		t.Fatalf("got %+v", limits)
+	}
+}
+
+func TestApplyAppend(t *testing.T) {
+	c := conf()
+	if err := Apply(c, []Op{{Op: "add", Path: "/registries/-", Value: "c"}}); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	registries := c["registries"].([]any)
+	if !reflect.DeepEqual(registries, []any{"a", "b", "c"}) {
+		t.Fatalf("got %+v", registries)
+	}
+}
+
+func TestApplyRemoveKey(t *testing.T) {
+	c := conf()
+	if err := Apply(c, []Op{{Op: "remove", Path: "/worker_port"}}); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if _, ok := c["worker_port"]; ok {
+		t.Fatal("worker_port was not removed")
+	}
+}
+
+func TestApplyRemoveArrayElement(t *testing.T) {
+	c := conf()
+	if err := Apply(c, []Op{{Op: "remove", Path: "/registries/0"}}); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	registries := c["registries"].([]any)
+	if !reflect.DeepEqual(registries, []any{"b"}) {
+		t.Fatalf("got %+v", registries)
+	}
+}
+
+func TestApplyIncrement(t *testing.T) {
+	c := conf()
+	if err := Apply(c, []Op{{Op: "incr", Path: "/limits/procs", Value: float64(5)}}); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	limits := c["limits"].(map[string]any)
+	if limits["procs"] != float64(15) {
+		t.Fatalf("procs = %v, want 15", limits["procs"])
+	}
+}
+
+func TestApplyUnsupportedOp(t *testing.T) {
+	c := conf()
+	if err := Apply(c, []Op{{Op: "move", Path: "/x"}}); err == nil {
+		t.Fatal("expected an error for an unsupported op")
+	}
+}
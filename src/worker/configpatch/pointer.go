@@ -0,0 +1,214 @@
+package configpatch
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// splitPointer decodes an RFC 6901 JSON Pointer ("/a/b/0") into its
+// unescaped reference tokens ("~1" -> "/", "~0" -> "~").  The empty
+// pointer ("") addresses the whole document and splits to no tokens.
+func splitPointer(ptr string) ([]string, error) {
+	if ptr == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(ptr, "/") {
+		return nil, fmt.Errorf("JSON Pointer must start with '/': %q", ptr)
+	}
+	raw := strings.Split(ptr[1:], "/")
+	tokens := make([]string, len(raw))
+	for i, t := range raw {
+		t = strings.ReplaceAll(t, "~1", "/")
+		t = strings.ReplaceAll(t, "~0", "~")
+		tokens[i] = t
+	}
+	return tokens, nil
+}
+
+// getAtPointer reads the value addressed by tokens out of root.
+func getAtPointer(root any, tokens []string) (any, error) {
+	cur := root
+	for i, tok := range tokens {
+		switch c := cur.(type) {
+		case map[string]any:
+			v, ok := c[tok]
+			if !ok {
+				return nil, fmt.Errorf("key '%s' not found", tok)
+			}
+			cur = v
+		case []any:
+			idx, err := arrayIndex(tok, len(c))
+			if err != nil {
+				return nil, err
+			}
+			cur = c[idx]
+		default:
+			return nil, fmt.Errorf("%s is a %T, can't descend into it", "/"+strings.Join(tokens[:i], "/"), cur)
+		}
+	}
+	return cur, nil
+}
+
+// setAtPointer writes value at the location tokens addresses in conf.  If
+// requireExisting is true (RFC 6902 "replace"), every token in the path
+// must already resolve; otherwise ("add"), missing intermediate maps are
+// created and a new key/array element may be introduced.
+func setAtPointer(conf map[string]any, tokens []string, value any, requireExisting bool) error {
+	if len(tokens) == 0 {
+		return fmt.Errorf("path must address a key, not the whole document")
+	}
+
+	last := tokens[len(tokens)-1]
+
+	// "-" (append) can't be handled one level up like a normal key/index
+	// write, since appending may reallocate the slice -- the new slice
+	// header has to be written back into whatever held the old one.
+	if last == "-" {
+		if requireExisting {
+			return fmt.Errorf("'-' (append) is only valid for 'add', not 'replace'")
+		}
+		if len(tokens) < 2 {
+			return fmt.Errorf("'-' must be preceded by the array's key")
+		}
+		grandparent, err := walkToParent(conf, tokens[:len(tokens)-2], false)
+		if err != nil {
+			return err
+		}
+		gp, ok := grandparent.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s is a %T, can't hold an array", "/"+strings.Join(tokens[:len(tokens)-2], "/"), grandparent)
+		}
+		arrKey := tokens[len(tokens)-2]
+		var arr []any
+		if existing, ok := gp[arrKey]; ok {
+			arr, ok = existing.([]any)
+			if !ok {
+				return fmt.Errorf("%s is a %T, not an array", arrKey, existing)
+			}
+		}
+		gp[arrKey] = append(arr, value)
+		return nil
+	}
+
+	c, err := walkToParent(conf, tokens[:len(tokens)-1], requireExisting)
+	if err != nil {
+		return err
+	}
+
+	switch parent := c.(type) {
+	case map[string]any:
+		if requireExisting {
+			if _, ok := parent[last]; !ok {
+				return fmt.Errorf("invalid option: '%s'", last)
+			}
+		}
+		parent[last] = value
+		return nil
+	case []any:
+		idx, err := arrayIndex(last, len(parent))
+		if err != nil {
+			return err
+		}
+		parent[idx] = value
+		return nil
+	default:
+		return fmt.Errorf("%s is a %T, not a map or array", "/"+strings.Join(tokens[:len(tokens)-1], "/"), c)
+	}
+}
+
+// removeAtPointer deletes the key or array element tokens addresses.  Like
+// setAtPointer's "-" append, removing an array element can't be done in
+// place one level up -- splicing it out reallocates the slice, so the new
+// slice header has to be written back into whatever held the old one.
+func removeAtPointer(conf map[string]any, tokens []string) error {
+	if len(tokens) == 0 {
+		return fmt.Errorf("path must address a key, not the whole document")
+	}
+
+	c, err := walkToParent(conf, tokens[:len(tokens)-1], true)
+	if err != nil {
+		return err
+	}
+
+	last := tokens[len(tokens)-1]
+	switch parent := c.(type) {
+	case map[string]any:
+		if _, ok := parent[last]; !ok {
+			return fmt.Errorf("invalid option: '%s'", last)
+		}
+		delete(parent, last)
+		return nil
+	case []any:
+		if len(tokens) < 2 {
+			return fmt.Errorf("removing an array element requires a key for the array itself")
+		}
+		idx, err := arrayIndex(last, len(parent))
+		if err != nil {
+			return err
+		}
+		grandparent, err := walkToParent(conf, tokens[:len(tokens)-2], true)
+		if err != nil {
+			return err
+		}
+		gp, ok := grandparent.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s is a %T, can't hold an array", "/"+strings.Join(tokens[:len(tokens)-2], "/"), grandparent)
+		}
+		arrKey := tokens[len(tokens)-2]
+		gp[arrKey] = append(parent[:idx:idx], parent[idx+1:]...)
+		return nil
+	default:
+		return fmt.Errorf("%s is a %T, not a map or array", "/"+strings.Join(tokens[:len(tokens)-1], "/"), c)
+	}
+}
+
+// walkToParent descends tokens from conf, returning whatever container
+// (map[string]any or []any) holds the final key.  When requireExisting is
+// true and an intermediate map is missing a key, it errors instead of
+// fabricating structure -- mirroring "replace"'s all-paths-must-exist
+// semantics; otherwise the missing map is created.  An array append ("-")
+// in the middle of the path is an error either way.
+func walkToParent(conf map[string]any, tokens []string, requireExisting bool) (any, error) {
+	var cur any = conf
+	for i, tok := range tokens {
+		switch c := cur.(type) {
+		case map[string]any:
+			v, ok := c[tok]
+			if !ok {
+				if requireExisting {
+					return nil, fmt.Errorf("key '%s' not found", tok)
+				}
+				v = map[string]any{}
+				c[tok] = v
+			}
+			cur = v
+		case []any:
+			idx, err := arrayIndex(tok, len(c))
+			if err != nil {
+				return nil, err
+			}
+			cur = c[idx]
+		default:
+			return nil, fmt.Errorf("%s refers to a %T, not a map", "/"+strings.Join(tokens[:i], "/"), cur)
+		}
+	}
+	return cur, nil
+}
+
+// arrayIndex resolves an RFC 6901 array token: either a literal index, or
+// "-" meaning "one past the end" (used by callers that special-case
+// append, since a plain []any index can't grow through this helper).
+func arrayIndex(tok string, length int) (int, error) {
+	if tok == "-" {
+		return length, fmt.Errorf("array append ('-') must be handled by the caller, which can replace the whole slice")
+	}
+	idx, err := strconv.Atoi(tok)
+	if err != nil {
+		return 0, fmt.Errorf("invalid array index: %q", tok)
+	}
+	if idx < 0 || idx >= length {
+		return 0, fmt.Errorf("array index %d out of range (len=%d)", idx, length)
+	}
+	return idx, nil
+}
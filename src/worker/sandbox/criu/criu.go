@@ -0,0 +1,116 @@
+// Package criu drives the `criu` binary to snapshot a running sandbox to
+// disk and restore many copies of it later, letting a pool serve warm
+// invokes (numpy/tensorflow already imported) without re-running a
+// fork-from-Zygote for every restored copy.
+package criu
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// DumpOpts controls what Dump asks criu to preserve.  Sandboxes hold open
+// Unix sockets and (for some lambdas) established TCP connections that
+// would otherwise make the dump fail outright.
+type DumpOpts struct {
+	// LeaveRunning keeps the original process alive after the dump
+	// completes, so the warm sandbox currently in the pool isn't lost.
+	LeaveRunning bool
+}
+
+// Dump snapshots the sandbox rooted at pid to imagesDir.  It captures the
+// mount namespace, cgroup, and open fds the sandbox already has, the same
+// ones initOLDir/SOCK set up when the sandbox was first created.
+func Dump(pid int, imagesDir string, opts DumpOpts) error {
+	if err := os.MkdirAll(imagesDir, 0700); err != nil {
+		return err
+	}
+
+	args := []string{
+		"dump",
+		"--tree", fmt.Sprintf("%d", pid),
+		"--images-dir", imagesDir,
+		"--tcp-established",
+		"--ext-unix-sk",
+	}
+	if opts.LeaveRunning {
+		args = append(args, "--leave-running")
+	}
+
+	cmd := exec.Command("criu", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("criu dump failed: %v", err)
+	}
+	return nil
+}
+
+// RestoreOpts describes the fresh mount/cgroup environment a restored
+// sandbox should land in; the caller is expected to have already prepared
+// rootfs bind mounts and a cgroup identical to the ones SOCK/initOLDir set
+// up for a normal sandbox.
+type RestoreOpts struct {
+	// Rootfs is the bind-mounted root the restored process should run
+	// under.
+	Rootfs string
+
+	// PidFile, if set, is where criu writes the restored process's PID.
+	// A private PID namespace plus --pidfile avoids collisions between
+	// the original sandbox's PID and the restored copy's.
+	PidFile string
+
+	// SocketPath is the control socket this restored copy should expose;
+	// each restored copy needs its own, since criu's --ext-unix-sk
+	// callback rewrites the one captured at dump time.
+	SocketPath string
+}
+
+// Restore brings up a new process from the snapshot at imagesDir, detached
+// from criu's own process tree so it can run as a normal child of the
+// sandbox pool.  On success it returns the restored process's PID.
+func Restore(imagesDir string, opts RestoreOpts) (pid int, err error) {
+	if opts.Rootfs == "" {
+		return 0, fmt.Errorf("RestoreOpts.Rootfs is required")
+	}
+
+	pidFile := opts.PidFile
+	if pidFile == "" {
+		pidFile = filepath.Join(imagesDir, "restore.pid")
+	}
+
+	args := []string{
+		"restore",
+		"--restore-detached",
+		"--images-dir", imagesDir,
+		"--root", opts.Rootfs,
+		"--pidfile", pidFile,
+		"--ext-unix-sk",
+		"--tcp-established",
+	}
+	if opts.SocketPath != "" {
+		// rebind the captured control socket to this copy's own path,
+		// so restored siblings don't fight over the same inode
+		args = append(args, "--external", fmt.Sprintf("unix-sk[%s]", opts.SocketPath))
+	}
+
+	cmd := exec.Command("criu", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return 0, fmt.Errorf("criu restore failed: %v", err)
+	}
+
+	b, err := os.ReadFile(pidFile)
+	if err != nil {
+		return 0, fmt.Errorf("criu restore reported success but pidfile is unreadable: %v", err)
+	}
+
+	if _, err := fmt.Sscanf(string(b), "%d", &pid); err != nil {
+		return 0, fmt.Errorf("could not parse restored pid from %s: %v", pidFile, err)
+	}
+
+	return pid, nil
+}
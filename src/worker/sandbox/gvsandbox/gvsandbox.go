@@ -0,0 +1,286 @@
+// Package gvsandbox implements the sandbox.SandboxPool/sandbox.Sandbox
+// interfaces on top of gVisor's runsc runtime, for users who want stronger
+// isolation than SOCK's seccomp+chroot for untrusted lambdas.
+package gvsandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/open-lambda/open-lambda/ol/worker/sandbox"
+)
+
+// GvisorPool creates Sandboxes by shelling out to `runsc` against an OCI
+// bundle derived from the base rootfs that initOLDir already dumped.
+type GvisorPool struct {
+	baseRootfs string
+	bundleRoot string
+	runtime    string // path to the runsc binary
+	platform   string // "ptrace" or "kvm"
+	network    string // runsc --network: "sandbox", "host", or "none"
+	limits     ResourceLimits
+
+	mu   sync.Mutex
+	next int
+}
+
+// NewGvisorPool returns a pool rooted under bundleRoot, using the base
+// rootfs dumped at baseRootfs (the same one SOCK forks from).  runtime is
+// the runsc binary to exec, defaulting to "runsc" (found via $PATH) when
+// empty; platform and network are passed straight through as `runsc`'s
+// --platform/--network flags, left to runsc's own defaults when empty.
+//
+// The caller supplies these knobs and the resource limits used to build
+// each bundle's OCI config; server.NewSandboxPool takes them from
+// common.Conf.Sandbox.Gvisor and common.Conf.Limits.
+func NewGvisorPool(bundleRoot, baseRootfs, runtime, platform, network string, limits ResourceLimits) (*GvisorPool, error) {
+	if err := os.MkdirAll(bundleRoot, 0700); err != nil {
+		return nil, err
+	}
+	if runtime == "" {
+		runtime = "runsc"
+	}
+
+	return &GvisorPool{
+		baseRootfs: baseRootfs,
+		bundleRoot: bundleRoot,
+		runtime:    runtime,
+		platform:   platform,
+		network:    network,
+		limits:     limits,
+	}, nil
+}
+
+// Create starts a new gVisor sandbox.  gVisor has no notion of forking a
+// warm parent, so parent is accepted (to satisfy sandbox.SandboxPool) but
+// ignored; every lambda gets a fresh runsc container.
+func (pool *GvisorPool) Create(parent sandbox.Sandbox, isLeaf bool, codeDir, scratchDir string, meta *sandbox.SandboxMeta) (sandbox.Sandbox, error) {
+	pool.mu.Lock()
+	id := fmt.Sprintf("gv-%d", pool.next)
+	pool.next++
+	pool.mu.Unlock()
+
+	bundleDir := filepath.Join(pool.bundleRoot, id)
+	rootfsDir := filepath.Join(bundleDir, "rootfs")
+	handlerDir := filepath.Join(rootfsDir, "handler")
+	scratchHostDir := filepath.Join(rootfsDir, "host")
+	if err := os.MkdirAll(rootfsDir, 0700); err != nil {
+		return nil, err
+	}
+
+	// bind the base rootfs in, then overlay the handler code and scratch
+	// space on top, the same layering SOCK already does for its
+	// root-sandboxes. isLeaf and meta aren't consulted here: unlike SOCK,
+	// gVisor has no zygote/parent-cache to pick between, so every lambda
+	// gets an identical, fresh container regardless of either.
+	if err := bindMount(pool.baseRootfs, rootfsDir); err != nil {
+		return nil, fmt.Errorf("could not bind base rootfs: %v", err)
+	}
+	if err := bindMount(codeDir, handlerDir); err != nil {
+		unmount(rootfsDir)
+		return nil, fmt.Errorf("could not bind handler code: %v", err)
+	}
+	if err := bindMount(scratchDir, scratchHostDir); err != nil {
+		unmount(handlerDir)
+		unmount(rootfsDir)
+		return nil, fmt.Errorf("could not bind scratch dir: %v", err)
+	}
+
+	if err := WriteOCIConfig(bundleDir, rootfsDir, pool.limits); err != nil {
+		unmount(scratchHostDir)
+		unmount(handlerDir)
+		unmount(rootfsDir)
+		return nil, fmt.Errorf("could not write OCI config: %v", err)
+	}
+
+	s := &gvisorSandbox{
+		id:             id,
+		pool:           pool,
+		bundleDir:      bundleDir,
+		rootfsDir:      rootfsDir,
+		handlerDir:     handlerDir,
+		scratchHostDir: scratchHostDir,
+	}
+
+	args := []string{"create"}
+	if pool.platform != "" {
+		args = append(args, "--platform="+pool.platform)
+	}
+	if pool.network != "" {
+		args = append(args, "--network="+pool.network)
+	}
+	args = append(args, "--bundle", bundleDir, id)
+
+	if err := s.runsc(args...); err != nil {
+		s.unmountAll()
+		return nil, fmt.Errorf("runsc create failed: %v", err)
+	}
+	if err := s.runsc("start", id); err != nil {
+		s.runsc("delete", id)
+		s.unmountAll()
+		return nil, fmt.Errorf("runsc start failed: %v", err)
+	}
+
+	// Leave the sandbox paused until the shim's Start RPC (or whatever
+	// else holds the Sandbox) resumes it with Unpause, mirroring the
+	// create-then-warm-but-idle pattern SOCK's root-sandboxes use.
+	if err := s.runsc("pause", id); err != nil {
+		s.runsc("delete", "--force", id)
+		s.unmountAll()
+		return nil, fmt.Errorf("runsc pause failed: %v", err)
+	}
+
+	return s, nil
+}
+
+// Cleanup destroys any containers runsc still knows about under this pool's
+// bundle root (e.g. left behind by a crashed worker), unmounting each
+// bundle's bind mounts first so the directory removal that follows
+// (handled by the caller, mirroring force-cleanup's existing pattern)
+// doesn't fail with EBUSY.
+func (pool *GvisorPool) Cleanup() {
+	entries, err := os.ReadDir(pool.bundleRoot)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		rootfsDir := filepath.Join(pool.bundleRoot, entry.Name(), "rootfs")
+		unmount(filepath.Join(rootfsDir, "host"))
+		unmount(filepath.Join(rootfsDir, "handler"))
+		unmount(rootfsDir)
+		runscCmd(pool.runtime, "delete", "--force", entry.Name())
+	}
+}
+
+type gvisorSandbox struct {
+	id             string
+	pool           *GvisorPool
+	bundleDir      string
+	rootfsDir      string
+	handlerDir     string
+	scratchHostDir string
+}
+
+func (s *gvisorSandbox) ID() string {
+	return s.id
+}
+
+func (s *gvisorSandbox) Channel() (*sandbox.SandboxChannel, error) {
+	return &sandbox.SandboxChannel{Url: "unix://" + filepath.Join(s.bundleDir, "ol.sock")}, nil
+}
+
+func (s *gvisorSandbox) Pause() error {
+	return s.runsc("pause", s.id)
+}
+
+func (s *gvisorSandbox) Unpause() error {
+	return s.runsc("resume", s.id)
+}
+
+func (s *gvisorSandbox) Destroy(reason string) error {
+	if err := s.runsc("kill", s.id, "SIGKILL"); err != nil {
+		// already dead is fine; we're tearing down regardless
+	}
+	if err := s.runsc("delete", s.id); err != nil {
+		return fmt.Errorf("runsc delete failed (%s): %v", reason, err)
+	}
+	s.unmountAll()
+	return os.RemoveAll(s.bundleDir)
+}
+
+// unmountAll tears down the bind mounts Create set up, in the reverse
+// order they were created, the same pattern worker.cleanup() already uses
+// for SOCK's root-sandboxes.
+func (s *gvisorSandbox) unmountAll() {
+	unmount(s.scratchHostDir)
+	unmount(s.handlerDir)
+	unmount(s.rootfsDir)
+}
+
+func unmount(path string) {
+	syscall.Unmount(path, syscall.MNT_DETACH)
+}
+
+// runscStatsEvent is the subset of `runsc events --stats`'s JSON output we
+// need; the real event also carries CPU/network/block-IO counters we don't
+// surface yet.
+type runscStatsEvent struct {
+	Data struct {
+		Memory struct {
+			Usage struct {
+				Current int64 `json:"current"`
+			} `json:"usage"`
+		} `json:"memory"`
+	} `json:"data"`
+}
+
+func (s *gvisorSandbox) MemUsageKB() (int, error) {
+	out, err := exec.Command(s.pool.runtime, "events", "--stats", s.id).Output()
+	if err != nil {
+		return 0, err
+	}
+
+	var event runscStatsEvent
+	if err := json.Unmarshal(out, &event); err != nil {
+		return 0, fmt.Errorf("could not parse `runsc events --stats` output: %v", err)
+	}
+
+	return int(event.Data.Memory.Usage.Current / 1024), nil
+}
+
+// runscState is the subset of `runsc state`'s JSON output we need.
+type runscState struct {
+	Pid int `json:"pid"`
+}
+
+// Pid reports the PID `runsc` assigned the sandbox's init process.
+func (s *gvisorSandbox) Pid() (int, error) {
+	out, err := exec.Command(s.pool.runtime, "state", s.id).Output()
+	if err != nil {
+		return 0, err
+	}
+
+	var state runscState
+	if err := json.Unmarshal(out, &state); err != nil {
+		return 0, fmt.Errorf("could not parse `runsc state` output: %v", err)
+	}
+	return state.Pid, nil
+}
+
+// Checkpoint is unsupported: gVisor has no CRIU integration of its own, and
+// snapshotting a runsc sandbox would require the gVisor-specific
+// `runsc checkpoint`/`--shared-memory` tooling, which we don't drive here.
+func (s *gvisorSandbox) Checkpoint(outDir string) error {
+	return sandbox.ErrNotSupported
+}
+
+// Restore is unsupported; see Checkpoint.
+func (s *gvisorSandbox) Restore(imagesDir string) error {
+	return sandbox.ErrNotSupported
+}
+
+func (s *gvisorSandbox) runsc(args ...string) error {
+	return runscCmd(s.pool.runtime, args...)
+}
+
+func runscCmd(runtime string, args ...string) error {
+	if runtime == "" {
+		runtime = "runsc"
+	}
+	cmd := exec.Command(runtime, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func bindMount(src, dst string) error {
+	if err := os.MkdirAll(dst, 0700); err != nil {
+		return err
+	}
+	return exec.Command("mount", "--bind", src, dst).Run()
+}
@@ -0,0 +1,124 @@
+package gvsandbox
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// ResourceLimits mirrors the handful of per-sandbox limits SOCK already
+// enforces via cgroups (common.Conf.Limits, in the chunk of this repo that
+// owns worker/common), so a gVisor bundle's OCI resources block matches
+// what SOCK would apply to the same lambda.
+type ResourceLimits struct {
+	MemMB      int
+	CPUPercent int
+	Procs      int
+}
+
+// ociSpec is the subset of the OCI runtime spec (config-schema.json) that
+// runsc actually looks at for our single-process, no-TTY lambda containers.
+// We round-trip it with encoding/json rather than pulling in the full OCI
+// runtime-spec module, since this is the only consumer.
+type ociSpec struct {
+	OCIVersion string      `json:"ociVersion"`
+	Root       ociRoot     `json:"root"`
+	Mounts     []ociMount  `json:"mounts"`
+	Process    ociProcess  `json:"process"`
+	Linux      ociLinux    `json:"linux"`
+}
+
+type ociRoot struct {
+	Path     string `json:"path"`
+	Readonly bool   `json:"readonly"`
+}
+
+type ociMount struct {
+	Destination string   `json:"destination"`
+	Type        string   `json:"type"`
+	Source      string   `json:"source"`
+	Options     []string `json:"options,omitempty"`
+}
+
+type ociProcess struct {
+	Terminal bool     `json:"terminal"`
+	Cwd      string   `json:"cwd"`
+	Args     []string `json:"args"`
+	Env      []string `json:"env"`
+}
+
+type ociLinux struct {
+	Namespaces []ociNamespace   `json:"namespaces"`
+	Resources  *ociResources    `json:"resources,omitempty"`
+}
+
+type ociNamespace struct {
+	Type string `json:"type"`
+}
+
+type ociResources struct {
+	Memory *ociMemory `json:"memory,omitempty"`
+	CPU    *ociCPU    `json:"cpu,omitempty"`
+	Pids   *ociPids   `json:"pids,omitempty"`
+}
+
+type ociMemory struct {
+	Limit int64 `json:"limit"`
+}
+
+type ociCPU struct {
+	Quota  int64 `json:"quota,omitempty"`
+	Period uint64 `json:"period,omitempty"`
+}
+
+type ociPids struct {
+	Limit int64 `json:"limit"`
+}
+
+// WriteOCIConfig generates an OCI runtime spec (config.json) next to
+// rootfsDir and writes it to bundleDir, so that `runsc create` (or any
+// other OCI-compliant runtime) can consume the bundle directly.
+func WriteOCIConfig(bundleDir, rootfsDir string, limits ResourceLimits) error {
+	spec := ociSpec{
+		OCIVersion: "1.0.2",
+		Root: ociRoot{
+			Path:     rootfsDir,
+			Readonly: false,
+		},
+		Mounts: []ociMount{
+			{Destination: "/proc", Type: "proc", Source: "proc"},
+			{Destination: "/dev", Type: "tmpfs", Source: "tmpfs", Options: []string{"nosuid", "strictatime", "mode=755", "size=65536k"}},
+		},
+		Process: ociProcess{
+			Terminal: false,
+			Cwd:      "/",
+			Args:     []string{"/ol-init"},
+			Env:      []string{"PATH=/usr/local/bin:/usr/bin:/bin"},
+		},
+		Linux: ociLinux{
+			Namespaces: []ociNamespace{
+				{Type: "pid"},
+				{Type: "ipc"},
+				{Type: "uts"},
+				{Type: "mount"},
+				{Type: "network"},
+			},
+			Resources: &ociResources{
+				Memory: &ociMemory{Limit: int64(limits.MemMB) * 1024 * 1024},
+				CPU:    &ociCPU{Quota: int64(limits.CPUPercent) * 1000, Period: 100000},
+				Pids:   &ociPids{Limit: int64(limits.Procs)},
+			},
+		},
+	}
+
+	b, err := json.MarshalIndent(spec, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(bundleDir, 0700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(bundleDir, "config.json"), b, 0644)
+}
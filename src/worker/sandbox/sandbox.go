@@ -0,0 +1,74 @@
+// Package sandbox defines the interfaces that every lambda execution
+// backend (SOCK, Docker, gVisor, ...) implements, plus the small set of
+// types those backends pass between each other.
+package sandbox
+
+import "errors"
+
+// ErrNotSupported is returned by Checkpoint/Restore on backends (Docker,
+// gVisor) that have no CRIU-based snapshot support.
+var ErrNotSupported = errors.New("not supported by this sandbox backend")
+
+// SandboxMeta carries the installs/imports a lambda declared, so a pool can
+// decide which cached parent (if any) to fork or restore from.
+type SandboxMeta struct {
+	Installs []string
+	Imports  []string
+}
+
+// Sandbox is a single, running lambda execution environment.  Every backend
+// (SOCK, Docker, gVisor, ...) returns a type satisfying this interface from
+// its SandboxPool's Create.
+type Sandbox interface {
+	// ID returns the unique ID of the sandbox.
+	ID() string
+
+	// Channel returns (and lazily dials, on first call) the control
+	// connection used to send invoke requests to the sandbox.
+	Channel() (*SandboxChannel, error)
+
+	// Pause freezes the sandbox so it stops burning CPU while idle.
+	Pause() error
+
+	// Unpause resumes a previously paused sandbox.
+	Unpause() error
+
+	// Destroy tears down the sandbox and reclaims its resources.  reason is
+	// used only for logging.
+	Destroy(reason string) error
+
+	// MemUsageKB reports current RSS, as read from the sandbox's cgroup.
+	MemUsageKB() (int, error)
+
+	// Pid returns the OS pid of the sandbox's init process.
+	Pid() (int, error)
+
+	// Checkpoint snapshots the sandbox to outDir with CRIU so it can later
+	// be restored via Restore, instead of being forked from a Zygote.
+	// Backends without CRIU support (Docker, gVisor) return
+	// ErrNotSupported.
+	Checkpoint(outDir string) error
+
+	// Restore replaces the sandbox's process with one resumed from a
+	// snapshot previously written by Checkpoint.  Backends without CRIU
+	// support (Docker, gVisor) return ErrNotSupported.
+	Restore(imagesDir string) error
+}
+
+// SandboxChannel is the control connection used to dispatch invokes to a
+// Sandbox; the transport (unix socket today) is backend-specific.
+type SandboxChannel struct {
+	Url string
+}
+
+// SandboxPool creates and recycles Sandboxes for a single lambda.  Each
+// backend (sock, docker, gvsandbox, ...) provides its own implementation.
+type SandboxPool interface {
+	// Create starts a new Sandbox for the given code/scratch dirs.  parent
+	// may be nil; when non-nil, the new sandbox is forked/derived from it.
+	Create(parent Sandbox, isLeaf bool, codeDir, scratchDir string, meta *SandboxMeta) (Sandbox, error)
+
+	// Cleanup releases any resources held by the pool itself (as opposed to
+	// the individual sandboxes it created).
+	Cleanup()
+}
@@ -0,0 +1,91 @@
+// Package sandboxview renders the sandbox inventory a worker reports on
+// its /v1/sandboxes endpoint, for "ol status" -- as a human-readable
+// table, as JSON, or as Prometheus text exposition so operators can plug
+// a worker straight into Prometheus/Grafana without writing a sidecar.
+package sandboxview
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// Sandbox is one row of a worker's /v1/sandboxes response.
+type Sandbox struct {
+	ID            string  `json:"id"`
+	Lambda        string  `json:"lambda"`
+	State         string  `json:"state"`
+	Pid           int     `json:"pid"`
+	UptimeSec     float64 `json:"uptime"`
+	MemRssKB      int64   `json:"mem_rss"`
+	CPUNs         int64   `json:"cpu_ns"`
+	InvokeCount   int64   `json:"invoke_count"`
+	LastInvokeMs  float64 `json:"last_invoke_ms"`
+}
+
+// RenderTable writes a podman-ps-style aligned table of sandboxes to w.
+func RenderTable(sandboxes []Sandbox, w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tLAMBDA\tSTATE\tPID\tUPTIME\tMEM\tCPU\tINVOKES\tLAST")
+	for _, s := range sandboxes {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%.0fs\t%dKB\t%.2fs\t%d\t%.1fms\n",
+			s.ID, s.Lambda, s.State, s.Pid, s.UptimeSec, s.MemRssKB,
+			float64(s.CPUNs)/1e9, s.InvokeCount, s.LastInvokeMs)
+	}
+	return tw.Flush()
+}
+
+// RenderJSON writes sandboxes as a JSON array to w.
+func RenderJSON(sandboxes []Sandbox, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(sandboxes)
+}
+
+// RenderPrometheus writes sandboxes in the Prometheus text exposition
+// format, one metric family per measured value (memory, CPU, invokes,
+// uptime, last invoke duration), labeled by sandbox id, lambda, and state.
+func RenderPrometheus(sandboxes []Sandbox, w io.Writer) error {
+	families := []struct {
+		name string
+		help string
+		typ  string
+		val  func(Sandbox) float64
+	}{
+		{"ol_sandbox_memory_bytes", "Resident memory of the sandbox, in bytes.", "gauge",
+			func(s Sandbox) float64 { return float64(s.MemRssKB) * 1024 }},
+		{"ol_sandbox_cpu_seconds_total", "Cumulative CPU time consumed by the sandbox.", "counter",
+			func(s Sandbox) float64 { return float64(s.CPUNs) / 1e9 }},
+		{"ol_sandbox_invocations_total", "Number of invokes served by the sandbox.", "counter",
+			func(s Sandbox) float64 { return float64(s.InvokeCount) }},
+		{"ol_sandbox_uptime_seconds", "Time since the sandbox was created.", "gauge",
+			func(s Sandbox) float64 { return s.UptimeSec }},
+		{"ol_sandbox_last_invoke_duration_ms", "Duration of the sandbox's most recent invoke.", "gauge",
+			func(s Sandbox) float64 { return s.LastInvokeMs }},
+	}
+
+	for _, f := range families {
+		fmt.Fprintf(w, "# HELP %s %s\n", f.name, f.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+		for _, s := range sandboxes {
+			fmt.Fprintf(w, "%s{id=%q,lambda=%q,state=%q} %v\n", f.name, s.ID, s.Lambda, s.State, f.val(s))
+		}
+	}
+	return nil
+}
+
+// Render dispatches to the renderer named by format ("table", "json", or
+// "prometheus"), defaulting to "table".
+func Render(sandboxes []Sandbox, format string, w io.Writer) error {
+	switch format {
+	case "", "table":
+		return RenderTable(sandboxes, w)
+	case "json":
+		return RenderJSON(sandboxes, w)
+	case "prometheus":
+		return RenderPrometheus(sandboxes, w)
+	default:
+		return fmt.Errorf("unknown --format %q (want table, json, or prometheus)", format)
+	}
+}
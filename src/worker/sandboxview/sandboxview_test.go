@@ -0,0 +1,83 @@
+package sandboxview
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+var testSandboxes = []Sandbox{
+	{ID: "gv-0", Lambda: "hello", State: "running", Pid: 1234, UptimeSec: 12, MemRssKB: 2048, CPUNs: 1500000000, InvokeCount: 3, LastInvokeMs: 4.5},
+}
+
+func TestRenderTable(t *testing.T) {
+	var buf bytes.Buffer
+	if err := RenderTable(testSandboxes, &buf); err != nil {
+		t.Fatalf("RenderTable: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "ID") || !strings.Contains(out, "LAMBDA") {
+		t.Fatalf("missing header row: %q", out)
+	}
+	if !strings.Contains(out, "gv-0") || !strings.Contains(out, "hello") {
+		t.Fatalf("missing sandbox row: %q", out)
+	}
+}
+
+func TestRenderJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := RenderJSON(testSandboxes, &buf); err != nil {
+		t.Fatalf("RenderJSON: %v", err)
+	}
+	var got []Sandbox
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("output isn't valid JSON: %v", err)
+	}
+	if len(got) != 1 || got[0].ID != "gv-0" {
+		t.Fatalf("unexpected round trip: %+v", got)
+	}
+}
+
+func TestRenderPrometheus(t *testing.T) {
+	var buf bytes.Buffer
+	if err := RenderPrometheus(testSandboxes, &buf); err != nil {
+		t.Fatalf("RenderPrometheus: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"# TYPE ol_sandbox_memory_bytes gauge",
+		`ol_sandbox_memory_bytes{id="gv-0",lambda="hello",state="running"} 2.097152e+06`,
+		"# TYPE ol_sandbox_invocations_total counter",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestRenderDispatch(t *testing.T) {
+	cases := []struct {
+		format string
+		want   string
+	}{
+		{"", "LAMBDA"},
+		{"table", "LAMBDA"},
+		{"json", `"id": "gv-0"`},
+		{"prometheus", "# HELP ol_sandbox_memory_bytes"},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		if err := Render(testSandboxes, c.format, &buf); err != nil {
+			t.Fatalf("Render(%q): %v", c.format, err)
+		}
+		if !strings.Contains(buf.String(), c.want) {
+			t.Fatalf("Render(%q): expected to contain %q, got:\n%s", c.format, c.want, buf.String())
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := Render(testSandboxes, "xml", &buf); err == nil {
+		t.Fatal("expected an error for an unknown format")
+	}
+}
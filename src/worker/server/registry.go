@@ -0,0 +1,99 @@
+package server
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/open-lambda/open-lambda/ol/worker/sandbox"
+	"github.com/open-lambda/open-lambda/ol/worker/sandboxview"
+)
+
+// trackedPool wraps a SandboxPool so the server can list what it's
+// currently holding open for /v1/sandboxes, without every backend having to
+// keep its own inventory.
+type trackedPool struct {
+	inner sandbox.SandboxPool
+
+	mu    sync.Mutex
+	boxes map[string]*trackedSandbox
+}
+
+// trackedSandbox is a Sandbox plus the bookkeeping /v1/sandboxes reports
+// that Sandbox itself doesn't carry (which lambda it's running, how long
+// it's been up).
+type trackedSandbox struct {
+	sandbox.Sandbox
+	pool      *trackedPool
+	lambda    string
+	createdAt time.Time
+}
+
+func newTrackedPool(inner sandbox.SandboxPool) *trackedPool {
+	return &trackedPool{inner: inner, boxes: make(map[string]*trackedSandbox)}
+}
+
+func (p *trackedPool) Create(parent sandbox.Sandbox, isLeaf bool, codeDir, scratchDir string, meta *sandbox.SandboxMeta) (sandbox.Sandbox, error) {
+	sb, err := p.inner.Create(parent, isLeaf, codeDir, scratchDir, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &trackedSandbox{
+		Sandbox:   sb,
+		pool:      p,
+		lambda:    filepath.Base(codeDir),
+		createdAt: time.Now(),
+	}
+
+	p.mu.Lock()
+	p.boxes[sb.ID()] = t
+	p.mu.Unlock()
+
+	return t, nil
+}
+
+func (p *trackedPool) Cleanup() {
+	p.inner.Cleanup()
+}
+
+// Destroy overrides the embedded Sandbox's so the registry forgets about a
+// sandbox as soon as it's torn down, not just when the pool is cleaned up.
+func (t *trackedSandbox) Destroy(reason string) error {
+	err := t.Sandbox.Destroy(reason)
+	t.pool.mu.Lock()
+	delete(t.pool.boxes, t.Sandbox.ID())
+	t.pool.mu.Unlock()
+	return err
+}
+
+// snapshot renders the pool's current sandboxes in sandboxview's format.
+// CPU time and invoke-count bookkeeping belong to the invoke-serving path,
+// which isn't implemented in this part of the repo yet, so those fields
+// always report zero rather than being fabricated.
+func (p *trackedPool) snapshot() []sandboxview.Sandbox {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	out := make([]sandboxview.Sandbox, 0, len(p.boxes))
+	for _, t := range p.boxes {
+		state := "running"
+		pid, err := t.Pid()
+		if err != nil {
+			state = "unknown"
+		}
+		memKB, err := t.MemUsageKB()
+		if err != nil {
+			memKB = 0
+		}
+		out = append(out, sandboxview.Sandbox{
+			ID:        t.ID(),
+			Lambda:    t.lambda,
+			State:     state,
+			Pid:       pid,
+			UptimeSec: time.Since(t.createdAt).Seconds(),
+			MemRssKB:  int64(memKB),
+		})
+	}
+	return out
+}
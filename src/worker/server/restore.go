@@ -0,0 +1,36 @@
+package server
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/open-lambda/open-lambda/ol/common"
+	"github.com/open-lambda/open-lambda/ol/worker/sandbox"
+)
+
+// prewarmFromRestore pre-populates pool with count sandboxes restored from
+// the CRIU images at imagesDir (as written by a prior `ol checkpoint`),
+// instead of forking them fresh -- so a worker can come up already warm.
+//
+// Each copy still goes through the ordinary Create path to get a real,
+// bundle-backed Sandbox, then has its process replaced by Restore; a
+// backend without CRIU support (gVisor, today) surfaces that as
+// sandbox.ErrNotSupported, same as calling Restore any other way.
+func prewarmFromRestore(pool sandbox.SandboxPool, imagesDir string, count int) error {
+	if count <= 0 {
+		count = 1
+	}
+
+	for i := 0; i < count; i++ {
+		scratchDir := filepath.Join(common.Conf.Worker_dir, "restore-scratch", fmt.Sprintf("%d", i))
+		sb, err := pool.Create(nil, true, imagesDir, scratchDir, &sandbox.SandboxMeta{})
+		if err != nil {
+			return fmt.Errorf("could not create sandbox %d/%d to restore into: %v", i+1, count, err)
+		}
+		if err := sb.Restore(imagesDir); err != nil {
+			return fmt.Errorf("could not restore sandbox %d/%d from %s: %v", i+1, count, imagesDir, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+// Package server builds the SandboxPool a worker process runs lambdas
+// against, selected by common.Conf.Sandbox.Kind, and serves the small HTTP
+// API `ol up`/`ol status` talk to.
+//
+// Only the gVisor backend (worker/sandbox/gvsandbox) is wired up here; SOCK
+// and Docker pools are owned by a different part of this repo.
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/open-lambda/open-lambda/ol/common"
+	"github.com/open-lambda/open-lambda/ol/worker/sandbox"
+	"github.com/open-lambda/open-lambda/ol/worker/sandbox/gvsandbox"
+)
+
+// NewSandboxPool builds the SandboxPool selected by
+// common.Conf.Sandbox.Kind.
+func NewSandboxPool() (sandbox.SandboxPool, error) {
+	switch common.Conf.Sandbox.Kind {
+	case "gvisor":
+		g := common.Conf.Sandbox.Gvisor
+		return gvsandbox.NewGvisorPool(
+			filepath.Join(common.Conf.Worker_dir, "gvisor-bundles"),
+			common.Conf.SOCK_base_path,
+			g.Runtime_path,
+			g.Platform,
+			g.Network,
+			gvsandbox.ResourceLimits{
+				MemMB:      common.Conf.Limits.Mem_mb,
+				CPUPercent: common.Conf.Limits.Cpu_percent,
+				Procs:      common.Conf.Limits.Procs,
+			},
+		)
+	case "", "sock", "docker":
+		return nil, fmt.Errorf("sandbox backend %q isn't implemented in this part of the repo (only \"gvisor\" is); set -o sandbox.kind=gvisor", common.Conf.Sandbox.Kind)
+	default:
+		return nil, fmt.Errorf("unknown sandbox backend %q (want \"gvisor\")", common.Conf.Sandbox.Kind)
+	}
+}
+
+// Main starts a worker: it builds the configured SandboxPool and serves
+// /status, /pid, and /v1/sandboxes on common.Conf.Worker_port until the
+// process is killed.
+func Main() error {
+	inner, err := NewSandboxPool()
+	if err != nil {
+		return err
+	}
+	pool := newTrackedPool(inner)
+	defer pool.Cleanup()
+
+	if common.Conf.Sandbox.Restore_from != "" {
+		if err := prewarmFromRestore(pool, common.Conf.Sandbox.Restore_from, common.Conf.Sandbox.Restore_count); err != nil {
+			return err
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", handleStatus)
+	mux.HandleFunc("/pid", handlePid)
+	mux.HandleFunc("/v1/sandboxes", pool.handleSandboxes)
+
+	return http.ListenAndServe(":"+common.Conf.Worker_port, mux)
+}
+
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, "ok")
+}
+
+func handlePid(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintf(w, "%d", os.Getpid())
+}
+
+// handleSandboxes serves the live sandbox inventory as JSON; sandboxview
+// (and thus "ol status") is responsible for rendering it as a table or
+// Prometheus text instead, by fetching this endpoint and reformatting.
+func (p *trackedPool) handleSandboxes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(p.snapshot()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,347 @@
+// Package shim implements the containerd Task Service v2 so that OL can be
+// registered as a containerd/Kubernetes runtime ("runtimeClassName:
+// openlambda"), scheduling lambdas as ordinary pods while still getting
+// OL's zygote/fork-based cold-start advantage under the hood.
+//
+// Each containerd "task" (one OCI bundle) is mapped onto a single OL
+// sandbox pulled from a sandbox.SandboxPool; the bundle's config.json
+// (or, failing that, the CreateTaskRequest's own annotations) tells us
+// which lambda handler to run.
+package shim
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	taskAPI "github.com/containerd/containerd/runtime/v2/task"
+	"github.com/containerd/ttrpc"
+
+	"github.com/open-lambda/open-lambda/ol/worker/sandbox"
+)
+
+// HandlerAnnotation is the OCI annotation key a bundle uses to tell the
+// shim which lambda handler to invoke; when set in the bundle's
+// config.json it takes precedence over a mount at HandlerMount.
+const HandlerAnnotation = "io.openlambda.handler"
+
+// HandlerMount is the destination path, inside the bundle's OCI config.json
+// mounts list, that the shim treats as the lambda handler when no
+// HandlerAnnotation is set.
+const HandlerMount = "/handler"
+
+// bundleConfig is the subset of an OCI config.json the shim reads to
+// locate the lambda handler; everything else in the bundle (rootfs,
+// process, namespaces, ...) is the concern of whatever runtime actually
+// executes it, not this mapping layer.
+type bundleConfig struct {
+	Annotations map[string]string `json:"annotations"`
+	Mounts      []struct {
+		Destination string `json:"destination"`
+		Source      string `json:"source"`
+	} `json:"mounts"`
+}
+
+// handlerDirFromBundle reads bundle/config.json to find the lambda handler
+// this task should run: first its io.openlambda.handler annotation, then a
+// mount at HandlerMount, then the same annotation in requestAnnotations,
+// falling back to a conventional "handler" directory inside the bundle.
+func handlerDirFromBundle(bundle string, requestAnnotations map[string]string) (string, error) {
+	fallback := filepath.Join(bundle, "handler")
+	if ann := requestAnnotations[HandlerAnnotation]; ann != "" {
+		fallback = ann
+	}
+
+	b, err := os.ReadFile(filepath.Join(bundle, "config.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fallback, nil
+		}
+		return "", fmt.Errorf("could not read bundle config.json: %v", err)
+	}
+
+	var cfg bundleConfig
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return "", fmt.Errorf("could not parse bundle config.json: %v", err)
+	}
+
+	if ann := cfg.Annotations[HandlerAnnotation]; ann != "" {
+		return ann, nil
+	}
+	for _, m := range cfg.Mounts {
+		if m.Destination == HandlerMount {
+			return m.Source, nil
+		}
+	}
+
+	return fallback, nil
+}
+
+// TaskService implements the containerd runtime v2 Task Service by mapping
+// each task onto an OL sandbox drawn from pool.
+type TaskService struct {
+	pool sandbox.SandboxPool
+
+	mu    sync.Mutex
+	tasks map[string]*ollTask
+}
+
+type ollTask struct {
+	id     string
+	bundle string
+	sb     sandbox.Sandbox
+	pid    uint32
+
+	// stdin/stdout/stderr are the open ends of the FIFOs containerd
+	// created for this task's IO (nil for any std stream the client
+	// didn't request).  The shim only holds them open so the other end
+	// doesn't see a premature EPIPE/EOF and closes them in CloseIO;
+	// relaying bytes between them and the sandbox's own handler process
+	// isn't implemented yet, since sandbox.Sandbox doesn't expose a raw
+	// stdio stream to attach them to.
+	stdin  *os.File
+	stdout *os.File
+	stderr *os.File
+}
+
+// openTaskIO opens whichever of stdin/stdout/stderr containerd provided
+// FIFO paths for, in the directions containerd expects: the shim reads
+// from stdin and writes to stdout/stderr.  Missing paths are left nil.
+func openTaskIO(stdinPath, stdoutPath, stderrPath string) (stdin, stdout, stderr *os.File, err error) {
+	if stdinPath != "" {
+		if stdin, err = os.OpenFile(stdinPath, os.O_RDONLY|syscall.O_NONBLOCK, 0); err != nil {
+			return nil, nil, nil, fmt.Errorf("could not open stdin fifo: %v", err)
+		}
+	}
+	if stdoutPath != "" {
+		if stdout, err = os.OpenFile(stdoutPath, os.O_WRONLY, 0); err != nil {
+			closeIfSet(stdin)
+			return nil, nil, nil, fmt.Errorf("could not open stdout fifo: %v", err)
+		}
+	}
+	if stderrPath != "" {
+		if stderr, err = os.OpenFile(stderrPath, os.O_WRONLY, 0); err != nil {
+			closeIfSet(stdin)
+			closeIfSet(stdout)
+			return nil, nil, nil, fmt.Errorf("could not open stderr fifo: %v", err)
+		}
+	}
+	return stdin, stdout, stderr, nil
+}
+
+func closeIfSet(f *os.File) {
+	if f != nil {
+		f.Close()
+	}
+}
+
+// NewTaskService returns a Task Service that creates/destroys sandboxes via
+// pool, one per containerd task.
+func NewTaskService(pool sandbox.SandboxPool) *TaskService {
+	return &TaskService{
+		pool:  pool,
+		tasks: make(map[string]*ollTask),
+	}
+}
+
+// Serve registers the task service on socketPath and blocks until the
+// ttrpc server is shut down.  socketPath is the one containerd passes the
+// shim on its command line.
+func Serve(socketPath string, pool sandbox.SandboxPool) error {
+	server, err := ttrpc.NewServer()
+	if err != nil {
+		return err
+	}
+
+	svc := NewTaskService(pool)
+	taskAPI.RegisterTaskService(server, svc)
+
+	if err := os.RemoveAll(socketPath); err != nil {
+		return err
+	}
+	listener, err := (&net.ListenConfig{}).Listen(context.Background(), "unix", socketPath)
+	if err != nil {
+		return err
+	}
+
+	return server.Serve(context.Background(), listener)
+}
+
+func (s *TaskService) lookup(id string) (*ollTask, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tasks[id]
+	if !ok {
+		return nil, fmt.Errorf("no such task: %s", id)
+	}
+	return t, nil
+}
+
+// Create maps a containerd task onto a fresh OL sandbox whose codeDir is
+// the handler directory, read from the bundle's config.json (io.openlambda.handler annotation, or a
+// mount at HandlerMount), falling back to the request's own annotations
+// and then to a conventional "handler" directory inside the bundle.
+func (s *TaskService) Create(ctx context.Context, r *taskAPI.CreateTaskRequest) (*taskAPI.CreateTaskResponse, error) {
+	handlerDir, err := handlerDirFromBundle(r.Bundle, r.Annotations)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve handler for task %s: %v", r.ID, err)
+	}
+
+	sb, err := s.pool.Create(nil, true, handlerDir, filepath.Join(r.Bundle, "scratch"), &sandbox.SandboxMeta{})
+	if err != nil {
+		return nil, fmt.Errorf("could not create sandbox for task %s: %v", r.ID, err)
+	}
+
+	stdin, stdout, stderr, err := openTaskIO(r.Stdin, r.Stdout, r.Stderr)
+	if err != nil {
+		sb.Destroy(fmt.Sprintf("failed to open IO for task %s", r.ID))
+		return nil, fmt.Errorf("could not open IO for task %s: %v", r.ID, err)
+	}
+
+	pid, err := sb.Pid()
+	if err != nil {
+		closeIfSet(stdin)
+		closeIfSet(stdout)
+		closeIfSet(stderr)
+		sb.Destroy(fmt.Sprintf("failed to read pid for task %s", r.ID))
+		return nil, fmt.Errorf("could not read pid for task %s: %v", r.ID, err)
+	}
+
+	s.mu.Lock()
+	s.tasks[r.ID] = &ollTask{
+		id:     r.ID,
+		bundle: r.Bundle,
+		sb:     sb,
+		pid:    uint32(pid),
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+	}
+	s.mu.Unlock()
+
+	return &taskAPI.CreateTaskResponse{Pid: uint32(pid)}, nil
+}
+
+// Start unpauses the sandbox backing id, so it begins serving invokes, and
+// refreshes its pid (gVisor/SOCK assign the init pid at create time, but a
+// future backend that execs fresh on Start would change it here).
+func (s *TaskService) Start(ctx context.Context, r *taskAPI.StartRequest) (*taskAPI.StartResponse, error) {
+	t, err := s.lookup(r.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.sb.Unpause(); err != nil {
+		return nil, err
+	}
+	if pid, err := t.sb.Pid(); err == nil {
+		t.pid = uint32(pid)
+	}
+	return &taskAPI.StartResponse{Pid: t.pid}, nil
+}
+
+// Kill tears down (Destroy) the sandbox backing id; OL sandboxes have no
+// intermediate signal handling beyond pause/resume, so any signal maps to
+// a full destroy.
+func (s *TaskService) Kill(ctx context.Context, r *taskAPI.KillRequest) (*ttrpc.Empty, error) {
+	t, err := s.lookup(r.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.sb.Destroy(fmt.Sprintf("killed by containerd (signal %d)", r.Signal)); err != nil {
+		return nil, err
+	}
+	return &ttrpc.Empty{}, nil
+}
+
+// Delete removes all bookkeeping for a task that has already been killed,
+// closing whichever of its IO FIFOs CloseIO didn't already close.
+func (s *TaskService) Delete(ctx context.Context, r *taskAPI.DeleteRequest) (*taskAPI.DeleteResponse, error) {
+	s.mu.Lock()
+	t, ok := s.tasks[r.ID]
+	delete(s.tasks, r.ID)
+	s.mu.Unlock()
+
+	if ok {
+		closeIfSet(t.stdin)
+		closeIfSet(t.stdout)
+		closeIfSet(t.stderr)
+	}
+	return &taskAPI.DeleteResponse{}, nil
+}
+
+// Wait blocks until the task's sandbox is destroyed.  OL sandboxes don't
+// currently expose a blocking wait, so for now we report immediately;
+// containerd treats a quick return the same as an already-exited task.
+func (s *TaskService) Wait(ctx context.Context, r *taskAPI.WaitRequest) (*taskAPI.WaitResponse, error) {
+	if _, err := s.lookup(r.ID); err != nil {
+		return nil, err
+	}
+	return &taskAPI.WaitResponse{ExitStatus: 0}, nil
+}
+
+// State reports whether the task's sandbox is still registered.
+func (s *TaskService) State(ctx context.Context, r *taskAPI.StateRequest) (*taskAPI.StateResponse, error) {
+	t, err := s.lookup(r.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &taskAPI.StateResponse{ID: t.id, Bundle: t.bundle, Pid: t.pid}, nil
+}
+
+// Pids returns the sandbox's init pid; OL sandboxes don't currently expose
+// the full process tree containerd's `ps` uses, just the one process.
+func (s *TaskService) Pids(ctx context.Context, r *taskAPI.PidsRequest) (*taskAPI.PidsResponse, error) {
+	t, err := s.lookup(r.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &taskAPI.PidsResponse{Processes: []*taskAPI.ProcessInfo{{Pid: t.pid}}}, nil
+}
+
+// Stats is unsupported for now; OL reports sandbox stats through its own
+// `/v1/sandboxes` endpoint rather than containerd's metrics path.
+func (s *TaskService) Stats(ctx context.Context, r *taskAPI.StatsRequest) (*taskAPI.StatsResponse, error) {
+	return nil, fmt.Errorf("stats not implemented by the openlambda shim")
+}
+
+// Exec is unsupported: OL sandboxes run exactly one handler process, so
+// there is no secondary exec target to attach to.
+func (s *TaskService) Exec(ctx context.Context, r *taskAPI.ExecProcessRequest) (*ttrpc.Empty, error) {
+	return nil, fmt.Errorf("exec not supported by the openlambda shim")
+}
+
+// CloseIO closes the task's stdin FIFO (the only stream containerd asks a
+// shim to close early, e.g. after streaming input to a container that then
+// reads EOF).  Create opened the FIFOs but does not relay bytes to/from the
+// sandbox's handler process, since sandbox.Sandbox has no raw stdio stream
+// to attach them to; this just releases the fd cleanly.
+func (s *TaskService) CloseIO(ctx context.Context, r *taskAPI.CloseIORequest) (*ttrpc.Empty, error) {
+	t, err := s.lookup(r.ID)
+	if err != nil {
+		return nil, err
+	}
+	if r.Stdin && t.stdin != nil {
+		t.stdin.Close()
+		t.stdin = nil
+	}
+	return &ttrpc.Empty{}, nil
+}
+
+// Shutdown tears down every task this service still knows about.
+func (s *TaskService) Shutdown(ctx context.Context, r *taskAPI.ShutdownRequest) (*ttrpc.Empty, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, t := range s.tasks {
+		t.sb.Destroy("shim shutdown")
+		closeIfSet(t.stdin)
+		closeIfSet(t.stdout)
+		closeIfSet(t.stderr)
+		delete(s.tasks, id)
+	}
+	return &ttrpc.Empty{}, nil
+}
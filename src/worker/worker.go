@@ -15,18 +15,34 @@ import (
 	"time"
 
 	docker "github.com/fsouza/go-dockerclient"
+	"github.com/open-lambda/open-lambda/ol/worker/configpatch"
+	"github.com/open-lambda/open-lambda/ol/worker/sandbox/criu"
 	dutil "github.com/open-lambda/open-lambda/ol/worker/sandbox/dockerutil"
+	"github.com/open-lambda/open-lambda/ol/worker/sandbox/gvsandbox"
+	"github.com/open-lambda/open-lambda/ol/worker/sandboxview"
+	"github.com/open-lambda/open-lambda/ol/worker/shim"
 
 	"github.com/open-lambda/open-lambda/ol/common"
 	"github.com/open-lambda/open-lambda/ol/worker/server"
 
-	"github.com/urfave/cli"	
+	"github.com/urfave/cli"
+)
+
+// defaultGvisorRuntime is the `runsc` binary force-cleanup shells out to
+// when it sweeps orphaned gVisor sandboxes; that can run against a worker
+// directory whose config.json was never loaded (e.g. after a crash), so
+// unlike everywhere else that now reads common.Conf.Sandbox.Gvisor, it
+// can't assume a loaded config to pull a runtime path from.
+const (
+	defaultGvisorRuntime = "runsc"
 )
 
 // modify the config.json file based on settings from cmdline: -o opt1=val1,opt2=val2,...
+// and/or a --patch-file of RFC 6902 JSON Patch operations.
 //
-// apply changes in optsStr to config from confPath, saving result to overridePath
-func overrideOpts(confPath, overridePath, optsStr string) error {
+// apply changes in optsStr and/or patchFile to config from confPath, saving
+// result to overridePath
+func overrideOpts(confPath, overridePath, optsStr, patchFile string) error {
 	b, err := ioutil.ReadFile(confPath)
 	if err != nil {
 		return err
@@ -36,53 +52,32 @@ func overrideOpts(confPath, overridePath, optsStr string) error {
 		return err
 	}
 
-	opts := strings.Split(optsStr, ",")
-	for _, opt := range opts {
-		parts := strings.Split(opt, "=")
-		if len(parts) != 2 {
-			return fmt.Errorf("Could not parse key=val: '%s'", opt)
-		}
-		keys := strings.Split(parts[0], ".")
-		val := parts[1]
-
-		c := conf
-		for i := 0; i < len(keys)-1; i++ {
-			sub, ok := c[keys[i]]
-			if !ok {
-				return fmt.Errorf("key '%s' not found", keys[i])
-			}
-			switch v := sub.(type) {
-			case map[string]any:
-				c = v
-			default:
-				return fmt.Errorf("%s refers to a %T, not a map", keys[i], c[keys[i]])
-			}
+	var ops []configpatch.Op
+	if optsStr != "" {
+		parsed, err := configpatch.ParseOptsString(optsStr)
+		if err != nil {
+			return err
 		}
-
-		key := keys[len(keys)-1]
-		prev, ok := c[key]
-		if !ok {
-			return fmt.Errorf("invalid option: '%s'", key)
+		ops = append(ops, parsed...)
+	}
+	if patchFile != "" {
+		pb, err := ioutil.ReadFile(patchFile)
+		if err != nil {
+			return err
 		}
-		switch prev.(type) {
-		case string:
-			c[key] = val
-		case float64:
-			c[key], err = strconv.Atoi(val)
-			if err != nil {
-				return err
-			}
-		case bool:
-			if strings.ToLower(val) == "true" {
-				c[key] = true
-			} else if strings.ToLower(val) == "false" {
-				c[key] = false
-			} else {
-				return fmt.Errorf("'%s' for %s not a valid boolean value", val, key)
-			}
-		default:
-			return fmt.Errorf("config values of type %T (%s) must be edited manually in the config file ", prev, key)
+		parsed, err := configpatch.ParsePatch(pb)
+		if err != nil {
+			return err
 		}
+		ops = append(ops, parsed...)
+	}
+
+	if err := configpatch.Apply(conf, ops); err != nil {
+		return err
+	}
+
+	if err := common.ValidateConf(conf); err != nil {
+		return fmt.Errorf("override would produce an invalid config: %v", err)
 	}
 
 	// save back config
@@ -171,6 +166,19 @@ func initOLDir(olPath string, dockerBaseImage string) (err error) {
 		return err
 	}
 
+	// also write an OCI config.json into the base dir, with its root path
+	// pointing at that same dir, so the base is itself a bundle `runsc`
+	// can consume directly (gvsandbox's Create still writes its own
+	// config.json into each per-sandbox bundle)
+	gvisorLimits := gvsandbox.ResourceLimits{
+		MemMB:      common.Conf.Limits.Mem_mb,
+		CPUPercent: common.Conf.Limits.Cpu_percent,
+		Procs:      common.Conf.Limits.Procs,
+	}
+	if err := gvsandbox.WriteOCIConfig(base, base, gvisorLimits); err != nil {
+		return err
+	}
+
 	fmt.Printf("Working Directory: %s\n\n", olPath)
 	fmt.Printf("Worker Defaults: \n%s\n\n", common.DumpConfStr())
 	fmt.Printf("You may modify the defaults here: %s\n\n", confPath)
@@ -186,38 +194,223 @@ func newOL(ctx *cli.Context) error {
 		return err
 	}
 
-	return initOLDir(olPath, ctx.String("image"))
+	if err := initOLDir(olPath, ctx.String("image")); err != nil {
+		return err
+	}
+
+	return installShimSymlink()
 }
 
-// status corresponds to the "status" command of the admin tool.
+// installShimSymlink drops a containerd-shim-openlambda-v2 symlink next to
+// the running binary, so containerd can exec it directly by runtime name
+// once "openlambda" is registered in /etc/containerd/config.toml; the
+// symlinked binary dispatches to "ol shim" the same way e.g. busybox
+// dispatches on argv[0].
+func installShimSymlink() error {
+	binPath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	link := filepath.Join(filepath.Dir(binPath), "containerd-shim-openlambda-v2")
+	if _, err := os.Lstat(link); err == nil {
+		return nil // already installed
+	}
+	return os.Symlink(binPath, link)
+}
+
+// status corresponds to the "status" command of the admin tool.  Without
+// --format it sends the basic /status ping; with --format it prints the
+// worker's sandbox inventory instead -- comparable to `podman ps`/`podman
+// stats` -- as a table, JSON, or Prometheus text exposition, optionally
+// refreshing every few seconds (--watch).
 func status(ctx *cli.Context) error {
 	olPath, err := common.GetOlPath(ctx)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("Worker Ping:\n")
-	err = common.LoadConf(filepath.Join(olPath, "config.json"))
-	if err != nil {
+	if err := common.LoadConf(filepath.Join(olPath, "config.json")); err != nil {
 		return err
 	}
 
-	url := fmt.Sprintf("http://localhost:%s/status", common.Conf.Worker_port)
+	watchSecs := ctx.Int("watch")
+	format := ctx.String("format")
+
+	for {
+		if err := printStatusOnce(format); err != nil {
+			return err
+		}
+		if watchSecs <= 0 {
+			return nil
+		}
+		time.Sleep(time.Duration(watchSecs) * time.Second)
+	}
+}
+
+func printStatusOnce(format string) error {
+	if format == "" {
+		fmt.Printf("Worker Ping:\n")
+		url := fmt.Sprintf("http://localhost:%s/status", common.Conf.Worker_port)
+		response, err := http.Get(url)
+		if err != nil {
+			return fmt.Errorf("could not send GET to %s", url)
+		}
+		defer response.Body.Close()
+		body, err := ioutil.ReadAll(response.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read body from GET to %s", url)
+		}
+		fmt.Printf("  %s => %s [%s]\n", url, body, response.Status)
+		fmt.Printf("\n")
+		return nil
+	}
+
+	// --format table/json/prometheus asks for the sandbox inventory served by the
+	// server package's /v1/sandboxes endpoint.
+	url := fmt.Sprintf("http://localhost:%s/v1/sandboxes", common.Conf.Worker_port)
+	response, err := http.Get(url)
+	if err != nil {
+		return fmt.Errorf("could not send GET to %s: %v (is the worker running?)", url, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s returned 404: this worker build doesn't serve a sandbox inventory; try `ol status` with no --format for a basic ping", url)
+	}
+
+	var sandboxes []sandboxview.Sandbox
+	if err := json.NewDecoder(response.Body).Decode(&sandboxes); err != nil {
+		return fmt.Errorf("could not parse response from %s: %v", url, err)
+	}
+
+	return sandboxview.Render(sandboxes, format, os.Stdout)
+}
+
+// resolveLambdaPid looks up the pid of a running sandbox for lambda by
+// querying the worker's own /v1/sandboxes, so "ol checkpoint --lambda=NAME"
+// doesn't require the caller to already know a pid.
+func resolveLambdaPid(ctx *cli.Context, lambda string) (int, error) {
+	olPath, err := common.GetOlPath(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if err := common.LoadConf(filepath.Join(olPath, "config.json")); err != nil {
+		return 0, err
+	}
+
+	url := fmt.Sprintf("http://localhost:%s/v1/sandboxes", common.Conf.Worker_port)
 	response, err := http.Get(url)
 	if err != nil {
-		return fmt.Errorf("could not send GET to %s", url)
+		return 0, fmt.Errorf("could not send GET to %s: %v (is the worker running?)", url, err)
 	}
 	defer response.Body.Close()
-	body, err := ioutil.ReadAll(response.Body)
+
+	var sandboxes []sandboxview.Sandbox
+	if err := json.NewDecoder(response.Body).Decode(&sandboxes); err != nil {
+		return 0, fmt.Errorf("could not parse response from %s: %v", url, err)
+	}
+
+	for _, sb := range sandboxes {
+		if sb.Lambda == lambda {
+			return sb.Pid, nil
+		}
+	}
+	return 0, fmt.Errorf("no running sandbox found for lambda %q", lambda)
+}
+
+// checkpoint corresponds to the "checkpoint" command of the admin tool.
+//
+// It CRIU-dumps the sandbox running as --pid (or --lambda, resolved via the
+// running worker's /v1/sandboxes) to disk, so it can later be restored (see
+// "restore") instead of forked from a Zygote.
+func checkpoint(ctx *cli.Context) error {
+	pid := ctx.Int("pid")
+	lambda := ctx.String("lambda")
+	if pid <= 0 && lambda == "" {
+		return fmt.Errorf("either --pid or --lambda is required (see `ol status --format json` for a sandbox's pid and lambda name)")
+	}
+	if pid <= 0 {
+		resolved, err := resolveLambdaPid(ctx, lambda)
+		if err != nil {
+			return err
+		}
+		pid = resolved
+	}
+	out := ctx.String("out")
+	if out == "" {
+		return fmt.Errorf("--out is required")
+	}
+	absOut, err := filepath.Abs(out)
 	if err != nil {
-		return fmt.Errorf("failed to read body from GET to %s", url)
+		return err
+	}
+
+	if err := criu.Dump(pid, absOut, criu.DumpOpts{LeaveRunning: true}); err != nil {
+		return err
 	}
-	fmt.Printf("  %s => %s [%s]\n", url, body, response.Status)
-	fmt.Printf("\n")
 
+	fmt.Printf("checkpointed pid %d to %s\n", pid, absOut)
 	return nil
 }
 
+// restore corresponds to the "restore" command of the admin tool.
+//
+// It CRIU-restores a sandbox previously checkpointed with "checkpoint",
+// printing the restored process's new pid.  This standalone command brings
+// the process back up detached under criu without registering it with any
+// pool; to pre-populate a worker's own pool with restored sandboxes on
+// startup (so they actually serve invokes), use `ol up -o
+// sandbox.restore_from=DIR` instead (see server.prewarmFromRestore).
+func restore(ctx *cli.Context) error {
+	images := ctx.String("images")
+	if images == "" {
+		return fmt.Errorf("--images is required")
+	}
+	rootfs := ctx.String("rootfs")
+	if rootfs == "" {
+		return fmt.Errorf("--rootfs is required")
+	}
+
+	pid, err := criu.Restore(images, criu.RestoreOpts{
+		Rootfs:     rootfs,
+		SocketPath: ctx.String("socket"),
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("restored pid %d from %s\n", pid, images)
+	return nil
+}
+
+// shim corresponds to the "shim" command of the admin tool.
+//
+// It starts a containerd Task Service v2 ttrpc server on the socket path
+// containerd passes on the command line, so containerd (and, through it,
+// Kubernetes via runtimeClassName: openlambda) can schedule lambdas as
+// ordinary tasks/pods while still getting OL's sandbox pool underneath.
+func shimServe(ctx *cli.Context) error {
+	olPath, err := common.GetOlPath(ctx)
+	if err != nil {
+		return err
+	}
+	if err := common.LoadConf(filepath.Join(olPath, "config.json")); err != nil {
+		return err
+	}
+
+	socket := ctx.String("socket")
+	if socket == "" {
+		return fmt.Errorf("--socket is required (containerd passes this as -address)")
+	}
+
+	pool, err := server.NewSandboxPool()
+	if err != nil {
+		return err
+	}
+
+	return shim.Serve(socket, pool)
+}
+
 // "up" corresponds to the "up" command of the admin tool.
 //
 // The JSON config in the cluster template directory will be populated for each
@@ -242,9 +435,10 @@ func up(ctx *cli.Context) error {
 
 	confPath := filepath.Join(olPath, "config.json")
 	overrides := ctx.String("options")
-	if overrides != "" {
+	patchFile := ctx.String("patch-file")
+	if overrides != "" || patchFile != "" {
 		overridesPath := confPath + ".overrides"
-		err = overrideOpts(confPath, overridesPath, overrides)
+		err = overrideOpts(confPath, overridesPath, overrides, patchFile)
 		if err != nil {
 			return err
 		}
@@ -463,6 +657,30 @@ func cleanup(ctx *cli.Context) error {
 		fmt.Printf("could not remove worker.pid: %s\n", err.Error())
 	}
 
+	gvBundles := filepath.Join(olPath, "worker", "gvisor-bundles")
+	fmt.Printf("ATTEMPT to cleanup gVisor sandboxes at %s\n", gvBundles)
+
+	if entries, err := ioutil.ReadDir(gvBundles); err != nil {
+		fmt.Printf("could not find gVisor bundle dir: %s\n", err.Error())
+	} else {
+		for _, entry := range entries {
+			rootfsDir := filepath.Join(gvBundles, entry.Name(), "rootfs")
+			fmt.Printf("try unmounting %s\n", rootfsDir)
+			if err := syscall.Unmount(filepath.Join(rootfsDir, "handler"), syscall.MNT_DETACH); err != nil {
+				fmt.Printf("could not unmount: %s\n", err.Error())
+			}
+			if err := syscall.Unmount(rootfsDir, syscall.MNT_DETACH); err != nil {
+				fmt.Printf("could not unmount: %s\n", err.Error())
+			}
+
+			fmt.Printf("try deleting orphaned gVisor sandbox %s\n", entry.Name())
+			cmd := exec.Command(defaultGvisorRuntime, "delete", "--force", entry.Name())
+			if err := cmd.Run(); err != nil {
+				fmt.Printf("could not delete %s: %s\n", entry.Name(), err.Error())
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -489,13 +707,20 @@ func WorkerCommands() []cli.Command {
 			Name:        "up",
 			Usage:       "Start an OL worker process (automatically calls 'new' and uses default if that wasn't already done)",
 			UsageText:   "ol up [--path=NAME] [--image=DOCKER-IMAGE] [--detach]",
-			Description: "Start an OL worker.",
+			Description: "Start an OL worker.  Pass -o sandbox.restore_from=DIR (and optionally " +
+				"sandbox.restore_count=N) to pre-populate the pool at startup by restoring N copies " +
+				"from CRIU images written by a prior `ol checkpoint`, instead of forking them.",
 			Flags: []cli.Flag{
 				pathFlag,
 				dockerImgFlag,
 				cli.StringFlag{
-					Name:  "options, o",
-					Usage: "Override options with: -o opt1=val1,opt2=val2/opt3.subopt31=val3",
+					Name: "options, o",
+					Usage: "Override options: dotted keys (opt1=val1,opt2.sub=val2), a JSON " +
+						"Pointer (/limits/procs=+50), or a full op (op=add,path=/x/-,value={\"a\":1})",
+				},
+				cli.StringFlag{
+					Name:  "patch-file",
+					Usage: "Path to a file of RFC 6902 JSON Patch operations to apply on top of --options",
 				},
 				cli.BoolFlag{
 					Name:  "detach, d",
@@ -514,10 +739,20 @@ func WorkerCommands() []cli.Command {
 		cli.Command{
 			Name:        "status",
 			Usage:       "check status of an OL worker process",
-			UsageText:   "ol status [--path=NAME]",
-			Description: "If no cluster name is specified, number of containers of each cluster is printed; otherwise the connection information for all containers in the given cluster will be displayed.",
-			Flags:       []cli.Flag{pathFlag},
-			Action:      status,
+			UsageText:   "ol status [--path=NAME] [--format=table|json|prometheus] [--watch=SECONDS]",
+			Description: "Pings the worker.  Passing --format instead requests its sandbox inventory (podman-ps style) from the worker's /v1/sandboxes endpoint: per-sandbox state, pid, uptime, memory, CPU, and invoke counts.",
+			Flags: []cli.Flag{
+				pathFlag,
+				cli.StringFlag{
+					Name:  "format",
+					Usage: "Sandbox inventory format: table, json, or prometheus (omit for just a ping)",
+				},
+				cli.IntFlag{
+					Name:  "watch",
+					Usage: "Refresh the table every N seconds instead of printing once",
+				},
+			},
+			Action: status,
 		},
 		cli.Command{
 			Name:      "force-cleanup",
@@ -526,6 +761,60 @@ func WorkerCommands() []cli.Command {
 			Flags:     []cli.Flag{pathFlag},
 			Action:    cleanup,
 		},
+		cli.Command{
+			Name:      "checkpoint",
+			Usage:     "CRIU-snapshot a warm sandbox to disk, for later restore via the \"restore\" command",
+			UsageText: "ol checkpoint (--pid=PID | --lambda=NAME) --out=DIR",
+			Flags: []cli.Flag{
+				pathFlag,
+				cli.IntFlag{
+					Name:  "pid",
+					Usage: "Pid of the sandbox to snapshot (see `ol status --format json`)",
+				},
+				cli.StringFlag{
+					Name:  "lambda",
+					Usage: "Lambda name to snapshot; resolved to a pid via the running worker's /v1/sandboxes",
+				},
+				cli.StringFlag{
+					Name:  "out",
+					Usage: "Directory to write the CRIU images to",
+				},
+			},
+			Action: checkpoint,
+		},
+		cli.Command{
+			Name:      "restore",
+			Usage:     "Restore a sandbox previously snapshotted with \"checkpoint\"",
+			UsageText: "ol restore --images=DIR --rootfs=DIR [--socket=PATH]",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "images",
+					Usage: "Directory of CRIU images written by a prior \"checkpoint\"",
+				},
+				cli.StringFlag{
+					Name:  "rootfs",
+					Usage: "Root filesystem the restored process should run under",
+				},
+				cli.StringFlag{
+					Name:  "socket",
+					Usage: "Control socket path the restored sandbox should expose (defaults to the one captured at checkpoint time)",
+				},
+			},
+			Action: restore,
+		},
+		cli.Command{
+			Name:      "shim",
+			Usage:     "Run as a containerd shim-v2 runtime (for use via runtimeClassName: openlambda)",
+			UsageText: "ol shim --socket=PATH [--path=NAME]",
+			Flags: []cli.Flag{
+				pathFlag,
+				cli.StringFlag{
+					Name:  "socket",
+					Usage: "ttrpc socket path containerd expects the shim to serve on",
+				},
+			},
+			Action: shimServe,
+		},
 	}
 
 	return cmds